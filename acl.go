@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ACLRule grants upload and/or delete permission to paths matching
+// Glob, optionally behind HTTP basic-auth or a bearer token. This is
+// loosely modeled on gohttpserver's per-directory .ghs.yml config.
+type ACLRule struct {
+	Glob   string    `yaml:"glob" json:"glob"`
+	Upload bool      `yaml:"upload" json:"upload"`
+	Delete bool      `yaml:"delete" json:"delete"`
+	Auth   *AuthRule `yaml:"auth" json:"auth"`
+}
+
+// AuthRule requires a request to present HTTP basic-auth matching one
+// of Basic, or a bearer token matching Token, before it is allowed.
+type AuthRule struct {
+	Basic map[string]string `yaml:"basic" json:"basic"`
+	Token string            `yaml:"token" json:"token"`
+}
+
+// Perms is the effective permission set for a path, after applying
+// every matching ACLRule from the root down.
+type Perms struct {
+	Upload, Delete bool
+	Auth           *AuthRule
+}
+
+// ACLConfig is the parsed contents of the -config file.
+type ACLConfig struct {
+	Rules []ACLRule `yaml:"rules" json:"rules"`
+}
+
+// loadACLConfig reads and parses an ACLConfig from name, as YAML
+// unless name ends in ".json".
+func loadACLConfig(name string) (*ACLConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(ACLConfig)
+	if filepath.Ext(name) == ".json" {
+		err = json.Unmarshal(b, cfg)
+	} else {
+		err = yaml.Unmarshal(b, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Perms returns the permissions that apply to relpath. Rules are
+// evaluated walking from "/" down to relpath, so a rule matching a
+// subdirectory overrides whatever its parents granted.
+func (c *ACLConfig) Perms(relpath string) Perms {
+	var perms Perms
+	if c == nil {
+		return perms
+	}
+	apply := func(dir string) {
+		for _, rule := range c.Rules {
+			if ok, _ := path.Match(rule.Glob, dir); !ok {
+				continue
+			}
+			perms.Upload = rule.Upload
+			perms.Delete = rule.Delete
+			if rule.Auth != nil {
+				perms.Auth = rule.Auth
+			}
+		}
+	}
+	dir := "/"
+	apply(dir)
+	for _, seg := range strings.Split(strings.Trim(path.Clean(relpath), "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		dir = path.Join(dir, seg)
+		apply(dir)
+	}
+	return perms
+}
+
+// authorize enforces auth against r, writing a 401 response and
+// returning false if the request doesn't satisfy it.
+func authorize(w http.ResponseWriter, r *http.Request, auth *AuthRule) bool {
+	if auth == nil {
+		return true
+	}
+	if auth.Token != "" && r.Header.Get("Authorization") == "Bearer "+auth.Token {
+		return true
+	}
+	if len(auth.Basic) > 0 {
+		if user, pass, ok := r.BasicAuth(); ok && auth.Basic[user] == pass {
+			return true
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="cheesedex"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestACLConfigPerms(t *testing.T) {
+	cfg := &ACLConfig{Rules: []ACLRule{
+		{Glob: "/*", Upload: true},
+		{Glob: "/private", Upload: false, Delete: false},
+		{Glob: "/private/*", Upload: false, Delete: false},
+	}}
+
+	tests := []struct {
+		path                string
+		wantUpload, wantDel bool
+	}{
+		{"/public/foo.txt", true, false},
+		{"/private", false, false},
+		{"/private/evil.txt", false, false},
+	}
+	for _, tc := range tests {
+		got := cfg.Perms(tc.path)
+		if got.Upload != tc.wantUpload || got.Delete != tc.wantDel {
+			t.Errorf("Perms(%q) = %+v, want Upload=%v Delete=%v",
+				tc.path, got, tc.wantUpload, tc.wantDel)
+		}
+	}
+}
+
+// TestACLConfigPermsSubdirOverridesParent confirms a subdirectory's
+// rule takes precedence over a broader parent grant, the property a
+// rename's destination check in handleRename relies on.
+func TestACLConfigPermsSubdirOverridesParent(t *testing.T) {
+	cfg := &ACLConfig{Rules: []ACLRule{
+		{Glob: "/*", Upload: true},
+		{Glob: "/private", Upload: false},
+	}}
+	if got := cfg.Perms("/private"); got.Upload {
+		t.Errorf("Perms(/private).Upload = true, want false (parent grant must not leak in)")
+	}
+	if got := cfg.Perms("/public"); !got.Upload {
+		t.Errorf("Perms(/public).Upload = false, want true")
+	}
+}
+
+func TestACLConfigPermsNilConfig(t *testing.T) {
+	var cfg *ACLConfig
+	got := cfg.Perms("/anything")
+	if got.Upload || got.Delete || got.Auth != nil {
+		t.Errorf("Perms on nil config = %+v, want zero value", got)
+	}
+}
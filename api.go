@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// wantsJSON reports whether r asked for the machine-readable form of
+// a response, via ?format=json or an Accept: application/json header,
+// so cheesedex can be scripted instead of scraped as HTML.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	for _, v := range r.Header["Accept"] {
+		if strings.Contains(v, "application/json") {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONEntry is one file or directory in a JSON directory listing.
+type JSONEntry struct {
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mtime"`
+	Mode          string    `json:"mode"`
+	IsDir         bool      `json:"is_dir"`
+	SymlinkTarget string    `json:"symlink_target,omitempty"`
+}
+
+// JSONReadMe is a directory's README, included raw and unrendered so
+// callers can format it themselves.
+type JSONReadMe struct {
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
+// JSONDir is the JSON form of a directory listing, served in place
+// of dir.html when wantsJSON(r).
+type JSONDir struct {
+	Path    string      `json:"path"`
+	Entries []JSONEntry `json:"entries"`
+	ReadMe  *JSONReadMe `json:"readme,omitempty"`
+}
+
+// serveDirJSON writes files, the listing of relpath, as a JSONDir.
+func (s *Server) serveDirJSON(w http.ResponseWriter, files []fs.DirEntry, relpath string) error {
+	dir := JSONDir{Path: relpath, Entries: []JSONEntry{}}
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+		fpath := path.Join(fsName(relpath), f.Name())
+		entry := JSONEntry{
+			Name:    f.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode().String(),
+			IsDir:   info.IsDir(),
+		}
+		if info.Mode().Type() == fs.ModeSymlink {
+			if target, err := s.store.Readlink(fpath); err == nil {
+				entry.SymlinkTarget = target
+			}
+		}
+		dir.Entries = append(dir.Entries, entry)
+
+		if dir.ReadMe == nil {
+			if format, ok := readmeFormat(f.Name()); ok {
+				if p, err := readAll(s.store, fpath); err == nil {
+					dir.ReadMe = &JSONReadMe{Format: format, Content: string(p)}
+				}
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(dir)
+}
+
+// readmeFormat returns the JSONReadMe.Format for a README file name,
+// mirroring the readme.txt/readme.html/readme.md names IndexContext.
+// Populate renders for the HTML view.
+func readmeFormat(name string) (format string, ok bool) {
+	switch strings.ToLower(name) {
+	case "readme.txt":
+		return "txt", true
+	case "readme.html":
+		return "html", true
+	case "readme.md":
+		return "md", true
+	default:
+		return "", false
+	}
+}
+
+// JSONSearchResult is one line of the NDJSON response handleSearch
+// writes when wantsJSON(r).
+type JSONSearchResult struct {
+	Path    string    `json:"path"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    string    `json:"mode"`
+}
+
+// serveSearchJSON streams entries to w as newline-delimited JSON,
+// flushing after each line so large result sets don't have to be
+// buffered by the client before the first match is usable.
+func serveSearchJSON(w http.ResponseWriter, entries []IndexEntry) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		enc.Encode(JSONSearchResult{
+			Path:    e.Path,
+			Name:    e.Name,
+			Size:    e.Size,
+			ModTime: e.ModTime,
+			Mode:    e.Mode.String(),
+		})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// JSONFileMeta is the ?meta=1 response for a single file: its
+// metadata plus a lazily computed, cached SHA-256.
+type JSONFileMeta struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    string    `json:"mode"`
+	SHA256  string    `json:"sha256"`
+}
+
+// handleFileMeta serves ?meta=1 on a regular file: its metadata and
+// SHA-256, computed once per {path, mtime, size} and cached after
+// that, the same way Server.packageMeta caches APK/IPA metadata.
+func (s *Server) handleFileMeta(w http.ResponseWriter, relpath string, stat fs.FileInfo) {
+	sum, err := s.fileSHA256(relpath, stat)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(JSONFileMeta{
+		Path:    relpath,
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Mode:    stat.Mode().String(),
+		SHA256:  sum,
+	})
+}
+
+// fileSHA256 returns the hex SHA-256 digest of the file at relpath.
+func (s *Server) fileSHA256(relpath string, stat fs.FileInfo) (string, error) {
+	key := metaCacheKey{fsName(relpath), stat.ModTime(), stat.Size()}
+
+	s.shaMu.Lock()
+	if s.shaCache == nil {
+		s.shaCache = make(map[metaCacheKey]string)
+	}
+	if sum, ok := s.shaCache[key]; ok {
+		s.shaMu.Unlock()
+		return sum, nil
+	}
+	s.shaMu.Unlock()
+
+	data, err := readAll(s.store, relpath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	hexSum := hex.EncodeToString(sum[:])
+
+	s.shaMu.Lock()
+	s.shaCache[key] = hexSum
+	s.shaMu.Unlock()
+	return hexSum, nil
+}
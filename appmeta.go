@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ipaPlistPrefix is the URL prefix handled by handleIPAPlist, e.g.
+// /-/ipa/plist/releases/app.ipa serves an OTA manifest for
+// /releases/app.ipa.
+const ipaPlistPrefix = "/-/ipa/plist/"
+
+// PackageMeta is the metadata dir.html shows for an .apk or .ipa
+// file, parsed lazily from the archive's manifest on first request.
+type PackageMeta struct {
+	Kind string // "apk" or "ipa"
+
+	// apk
+	PackageName  string
+	MainActivity string
+	VersionCode  string
+	VersionName  string
+
+	// ipa
+	BundleID string
+	Version  string
+}
+
+type metaCacheKey struct {
+	path  string
+	mtime time.Time
+	size  int64
+}
+
+// packageMeta returns the parsed PackageMeta for the .apk or .ipa at
+// relpath, reading and parsing the archive only once per
+// {path, mtime, size} and reusing the cached result after that.
+func (s *Server) packageMeta(relpath string) (*PackageMeta, error) {
+	name := fsName(relpath)
+	stat, err := s.store.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	key := metaCacheKey{name, stat.ModTime(), stat.Size()}
+
+	s.metaMu.Lock()
+	if s.metaCache == nil {
+		s.metaCache = make(map[metaCacheKey]*PackageMeta)
+	}
+	if m, ok := s.metaCache[key]; ok {
+		s.metaMu.Unlock()
+		return m, nil
+	}
+	s.metaMu.Unlock()
+
+	data, err := readAll(s.store, name)
+	if err != nil {
+		return nil, err
+	}
+	var meta *PackageMeta
+	switch strings.ToLower(path.Ext(name)) {
+	case ".apk":
+		meta, err = parseAPKMeta(data)
+	case ".ipa":
+		meta, err = parseIPAMeta(data)
+	default:
+		return nil, fmt.Errorf("%s is not an apk or ipa", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.metaMu.Lock()
+	s.metaCache[key] = meta
+	s.metaMu.Unlock()
+	return meta, nil
+}
+
+func parseAPKMeta(data []byte) (*PackageMeta, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	f, err := zr.Open("AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	manifestData, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseAXML(manifestData)
+	if err != nil {
+		return nil, fmt.Errorf("parsing AndroidManifest.xml: %w", err)
+	}
+	meta := &PackageMeta{Kind: "apk"}
+	meta.PackageName, _ = root.Attr("package")
+	meta.VersionCode, _ = root.Attr("versionCode")
+	meta.VersionName, _ = root.Attr("versionName")
+	meta.MainActivity = axmlMainActivity(root)
+	return meta, nil
+}
+
+// axmlMainActivity walks a decoded AndroidManifest.xml for the first
+// <activity> (or <activity-alias>) whose intent-filter declares the
+// MAIN action and LAUNCHER category.
+func axmlMainActivity(manifest *axmlElem) string {
+	var app *axmlElem
+	for _, c := range manifest.Children {
+		if c.Name == "application" {
+			app = c
+			break
+		}
+	}
+	if app == nil {
+		return ""
+	}
+	for _, act := range app.Children {
+		if act.Name != "activity" && act.Name != "activity-alias" {
+			continue
+		}
+		for _, filter := range act.Children {
+			if filter.Name != "intent-filter" {
+				continue
+			}
+			var hasMain, hasLauncher bool
+			for _, sub := range filter.Children {
+				name, _ := sub.Attr("name")
+				switch sub.Name {
+				case "action":
+					hasMain = hasMain || name == "android.intent.action.MAIN"
+				case "category":
+					hasLauncher = hasLauncher || name == "android.intent.category.LAUNCHER"
+				}
+			}
+			if hasMain && hasLauncher {
+				name, _ := act.Attr("name")
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func parseIPAMeta(data []byte) (*PackageMeta, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var plistData []byte
+	for _, f := range zr.File {
+		// Payload/<AppName>.app/Info.plist
+		if strings.HasPrefix(f.Name, "Payload/") && strings.HasSuffix(f.Name, ".app/Info.plist") &&
+			strings.Count(strings.TrimSuffix(strings.TrimPrefix(f.Name, "Payload/"), "Info.plist"), "/") == 1 {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			plistData, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if plistData == nil {
+		return nil, fmt.Errorf("Info.plist not found in ipa")
+	}
+	vals, err := plistStrings(plistData, []string{
+		"CFBundleIdentifier", "CFBundleShortVersionString", "CFBundleVersion",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing Info.plist: %w", err)
+	}
+	version := vals["CFBundleShortVersionString"]
+	if version == "" {
+		version = vals["CFBundleVersion"]
+	}
+	return &PackageMeta{
+		Kind:     "ipa",
+		BundleID: vals["CFBundleIdentifier"],
+		Version:  version,
+	}, nil
+}
+
+// handleIPAPlist serves /-/ipa/plist/<relpath>, an OTA install
+// manifest (see developer.apple.com/library, "Deploying an App")
+// pointing at the underlying .ipa URL.
+func (s *Server) handleIPAPlist(w http.ResponseWriter, r *http.Request, relpath string) {
+	if strings.ToLower(path.Ext(relpath)) != ".ipa" {
+		http.Error(w, "not an ipa file", http.StatusBadRequest)
+		return
+	}
+	meta, err := s.packageMeta(relpath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ipaURL := requestScheme(r) + "://" + r.Host + "/" + strings.TrimPrefix(relpath, "/")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, otaPlist(ipaURL, meta, path.Base(relpath)))
+}
+
+// installHREF returns the itms-services install link for relpath's
+// OTA plist, or "" if installing over HTTP (Apple requires HTTPS).
+func installHREF(r *http.Request, relpath string) string {
+	if requestScheme(r) != "https" {
+		return ""
+	}
+	plistURL := "https://" + r.Host + ipaPlistPrefix + strings.TrimPrefix(relpath, "/")
+	return "itms-services://?action=download-manifest&url=" + url.QueryEscape(plistURL)
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+const otaPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>items</key>
+	<array>
+		<dict>
+			<key>assets</key>
+			<array>
+				<dict>
+					<key>kind</key>
+					<string>software-package</string>
+					<key>url</key>
+					<string>%s</string>
+				</dict>
+			</array>
+			<key>metadata</key>
+			<dict>
+				<key>bundle-identifier</key>
+				<string>%s</string>
+				<key>bundle-version</key>
+				<string>%s</string>
+				<key>kind</key>
+				<string>software</string>
+				<key>title</key>
+				<string>%s</string>
+			</dict>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+func otaPlist(ipaURL string, meta *PackageMeta, title string) string {
+	return fmt.Sprintf(otaPlistTemplate,
+		html.EscapeString(ipaURL), html.EscapeString(meta.BundleID),
+		html.EscapeString(meta.Version), html.EscapeString(title))
+}
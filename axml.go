@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Minimal decoder for Android's compiled binary XML format (AXML), as
+// used by AndroidManifest.xml inside an APK. It only decodes enough
+// of the format (string pool plus start/end element chunks) to read
+// element names, attribute names, and attribute values; comments,
+// CDATA, and namespace chunks are skipped.
+
+const (
+	axmlChunkStringPool   = 0x0001
+	axmlChunkStartElement = 0x0102
+	axmlChunkEndElement   = 0x0103
+)
+
+type axmlStringPool struct {
+	strings []string
+}
+
+func (p *axmlStringPool) get(i int32) string {
+	if i < 0 || int(i) >= len(p.strings) {
+		return ""
+	}
+	return p.strings[i]
+}
+
+func parseAXMLStringPool(chunk []byte) (*axmlStringPool, error) {
+	if len(chunk) < 28 {
+		return nil, fmt.Errorf("axml: string pool chunk too short")
+	}
+	stringCount := binary.LittleEndian.Uint32(chunk[8:12])
+	flags := binary.LittleEndian.Uint32(chunk[16:20])
+	stringsStart := binary.LittleEndian.Uint32(chunk[20:24])
+	utf8 := flags&(1<<8) != 0
+
+	if int64(stringCount)*4 > int64(len(chunk)-28) {
+		return nil, fmt.Errorf("axml: string pool offset table truncated")
+	}
+	strs := make([]string, stringCount)
+	for i := range strs {
+		offOff := 28 + i*4
+		if offOff+4 > len(chunk) {
+			return nil, fmt.Errorf("axml: string pool offset table truncated")
+		}
+		rel := binary.LittleEndian.Uint32(chunk[offOff : offOff+4])
+		pos := int(stringsStart) + int(rel)
+		if pos >= len(chunk) {
+			continue
+		}
+		s, err := decodeAXMLString(chunk[pos:], utf8)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return &axmlStringPool{strings: strs}, nil
+}
+
+// decodeAXMLString decodes a single length-prefixed, NUL-terminated
+// string from the start of b, in either UTF-8 or UTF-16LE form.
+func decodeAXMLString(b []byte, utf8 bool) (string, error) {
+	if utf8 {
+		_, n := readAXMLLen8(b) // character count, unused
+		b = b[n:]
+		byteLen, n := readAXMLLen8(b)
+		b = b[n:]
+		if byteLen > len(b) {
+			return "", fmt.Errorf("axml: utf-8 string out of range")
+		}
+		return string(b[:byteLen]), nil
+	}
+	charLen, n := readAXMLLen16(b)
+	b = b[n:]
+	byteLen := charLen * 2
+	if byteLen > len(b) {
+		return "", fmt.Errorf("axml: utf-16 string out of range")
+	}
+	units := make([]uint16, charLen)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2 : i*2+2])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// readAXMLLen8 reads a 1-or-2-byte length as used by UTF-8 AXML
+// strings, returning the length and the number of bytes consumed.
+func readAXMLLen8(b []byte) (length, consumed int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	if b[0]&0x80 != 0 && len(b) >= 2 {
+		return int(b[0]&0x7f)<<8 | int(b[1]), 2
+	}
+	return int(b[0]), 1
+}
+
+// readAXMLLen16 reads a 1-or-2-uint16 length as used by UTF-16 AXML
+// strings, returning the length and the number of bytes consumed.
+func readAXMLLen16(b []byte) (length, consumed int) {
+	if len(b) < 2 {
+		return 0, 0
+	}
+	v := binary.LittleEndian.Uint16(b)
+	if v&0x8000 != 0 && len(b) >= 4 {
+		v2 := binary.LittleEndian.Uint16(b[2:4])
+		return int(v&0x7fff)<<16 | int(v2), 4
+	}
+	return int(v), 2
+}
+
+// axmlValueType mirrors Android's Res_value::dataType constants that
+// matter for manifest attributes.
+const (
+	axmlTypeIntDec = 0x10
+	axmlTypeIntHex = 0x11
+	axmlTypeBool   = 0x12
+)
+
+func formatAXMLValue(dataType byte, data uint32) string {
+	switch dataType {
+	case axmlTypeIntDec:
+		return fmt.Sprint(int32(data))
+	case axmlTypeIntHex:
+		return fmt.Sprintf("0x%x", data)
+	case axmlTypeBool:
+		if data != 0 {
+			return "true"
+		}
+		return "false"
+	default:
+		return fmt.Sprint(data)
+	}
+}
+
+// axmlElem is a decoded XML element: a name, its attributes in
+// document order, and its child elements.
+type axmlElem struct {
+	Name     string
+	Attrs    []axmlAttr
+	Children []*axmlElem
+}
+
+type axmlAttr struct {
+	Name  string
+	Value string
+}
+
+func (e *axmlElem) Attr(name string) (string, bool) {
+	for _, a := range e.Attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// parseAXML decodes a compiled Android binary XML document into its
+// root element.
+func parseAXML(data []byte) (*axmlElem, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("axml: file too short")
+	}
+	var pool *axmlStringPool
+	var stack []*axmlElem
+	var root *axmlElem
+
+	off := 8 // skip the outer ResXMLTree_header; its body is the chunk stream below
+	for off+8 <= len(data) {
+		ctype := binary.LittleEndian.Uint16(data[off:])
+		size := binary.LittleEndian.Uint32(data[off+4:])
+		if size < 8 || off+int(size) > len(data) {
+			break
+		}
+		chunk := data[off : off+int(size)]
+		switch ctype {
+		case axmlChunkStringPool:
+			p, err := parseAXMLStringPool(chunk)
+			if err != nil {
+				return nil, err
+			}
+			pool = p
+		case axmlChunkStartElement:
+			elem, err := parseAXMLStartElement(chunk, pool)
+			if err != nil {
+				return nil, err
+			}
+			if elem != nil {
+				if root == nil {
+					root = elem
+				}
+				if len(stack) > 0 {
+					parent := stack[len(stack)-1]
+					parent.Children = append(parent.Children, elem)
+				}
+				stack = append(stack, elem)
+			}
+		case axmlChunkEndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		off += int(size)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("axml: no root element found")
+	}
+	return root, nil
+}
+
+func parseAXMLStartElement(chunk []byte, pool *axmlStringPool) (*axmlElem, error) {
+	if pool == nil || len(chunk) < 36 {
+		return nil, nil
+	}
+	name := pool.get(int32(binary.LittleEndian.Uint32(chunk[20:24])))
+	attrStart := int(binary.LittleEndian.Uint16(chunk[24:26]))
+	attrCount := int(binary.LittleEndian.Uint16(chunk[28:30]))
+	elem := &axmlElem{Name: name}
+	base := 16 + attrStart
+	for i := 0; i < attrCount; i++ {
+		ao := base + i*20
+		if ao+20 > len(chunk) {
+			break
+		}
+		attrName := pool.get(int32(binary.LittleEndian.Uint32(chunk[ao+4 : ao+8])))
+		rawValue := int32(binary.LittleEndian.Uint32(chunk[ao+8 : ao+12]))
+		var value string
+		if rawValue >= 0 {
+			value = pool.get(rawValue)
+		} else {
+			dataType := chunk[ao+15]
+			data := binary.LittleEndian.Uint32(chunk[ao+16 : ao+20])
+			value = formatAXMLValue(dataType, data)
+		}
+		elem.Attrs = append(elem.Attrs, axmlAttr{Name: attrName, Value: value})
+	}
+	return elem, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// axmlStringPoolChunk builds a minimal UTF-8 AXML string pool chunk
+// containing strings, for use in tests.
+func axmlStringPoolChunk(strings []string) []byte {
+	count := len(strings)
+	var encoded [][]byte
+	var offsets []uint32
+	var pos uint32
+	for _, s := range strings {
+		b := []byte(s)
+		enc := append([]byte{byte(len(s)), byte(len(b))}, b...)
+		enc = append(enc, 0)
+		offsets = append(offsets, pos)
+		encoded = append(encoded, enc)
+		pos += uint32(len(enc))
+	}
+	var body []byte
+	for _, e := range encoded {
+		body = append(body, e...)
+	}
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	stringsStart := uint32(28 + 4*count)
+	chunkBody := make([]byte, 20)
+	binary.LittleEndian.PutUint32(chunkBody[0:4], uint32(count))
+	binary.LittleEndian.PutUint32(chunkBody[4:8], 0)
+	binary.LittleEndian.PutUint32(chunkBody[8:12], 1<<8) // utf8 flag
+	binary.LittleEndian.PutUint32(chunkBody[12:16], stringsStart)
+	binary.LittleEndian.PutUint32(chunkBody[16:20], 0)
+	for _, o := range offsets {
+		off := make([]byte, 4)
+		binary.LittleEndian.PutUint32(off, o)
+		chunkBody = append(chunkBody, off...)
+	}
+	chunkBody = append(chunkBody, body...)
+	size := 8 + len(chunkBody)
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint16(header[0:2], axmlChunkStringPool)
+	binary.LittleEndian.PutUint16(header[2:4], 0x1c)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(size))
+	return append(header, chunkBody...)
+}
+
+func TestParseAXMLStringPool(t *testing.T) {
+	chunk := axmlStringPoolChunk([]string{"manifest", "package"})
+	pool, err := parseAXMLStringPool(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.get(0); got != "manifest" {
+		t.Errorf("pool.get(0) = %q, want manifest", got)
+	}
+	if got := pool.get(1); got != "package" {
+		t.Errorf("pool.get(1) = %q, want package", got)
+	}
+	if got := pool.get(99); got != "" {
+		t.Errorf("pool.get(99) = %q, want empty for out-of-range index", got)
+	}
+}
+
+// TestParseAXMLStringPoolRejectsOversizedCount crafts a string pool
+// chunk that declares far more strings than it has offset-table room
+// for (as a malicious AndroidManifest.xml could), which must fail
+// instead of allocating a slice sized from the attacker's count.
+func TestParseAXMLStringPoolRejectsOversizedCount(t *testing.T) {
+	chunk := make([]byte, 28)
+	binary.LittleEndian.PutUint32(chunk[8:12], 1<<28) // stringCount: absurd for a 28-byte chunk
+	if _, err := parseAXMLStringPool(chunk); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestParseAXMLManifest decodes a minimal AndroidManifest.xml-shaped
+// document and confirms axmlMainActivity finds the launcher activity.
+func TestParseAXMLManifest(t *testing.T) {
+	strs := []string{
+		"manifest", "package", "com.example.app",
+		"application", "activity", "name", "com.example.app.MainActivity",
+		"intent-filter", "action", "android.intent.action.MAIN",
+		"category", "android.intent.category.LAUNCHER",
+	}
+	idx := make(map[string]int32)
+	for i, s := range strs {
+		idx[s] = int32(i)
+	}
+
+	u16 := func(v uint16) []byte { b := make([]byte, 2); binary.LittleEndian.PutUint16(b, v); return b }
+	u32 := func(v uint32) []byte { b := make([]byte, 4); binary.LittleEndian.PutUint32(b, v); return b }
+
+	startElem := func(name int32, attrs [][2]int32) []byte {
+		var attrBytes []byte
+		for _, a := range attrs {
+			attrBytes = append(attrBytes, u32(0xFFFFFFFF)...) // ns
+			attrBytes = append(attrBytes, u32(uint32(a[0]))...)
+			attrBytes = append(attrBytes, u32(uint32(a[1]))...) // rawValue (string ref)
+			attrBytes = append(attrBytes, u16(8)...)
+			attrBytes = append(attrBytes, 0, 3) // res0, dataType (string)
+			attrBytes = append(attrBytes, u32(0)...)
+		}
+		ext := append(u32(0xFFFFFFFF), u32(uint32(name))...)
+		ext = append(ext, u16(20)...)                 // attributeStart
+		ext = append(ext, u16(20)...)                 // attributeSize
+		ext = append(ext, u16(uint16(len(attrs)))...) // attributeCount
+		ext = append(ext, u16(0xFFFF)...)             // idIndex
+		ext = append(ext, u16(0xFFFF)...)             // classIndex
+		ext = append(ext, u16(0xFFFF)...)             // styleIndex
+		nodeHeader := append(u32(0), u32(0xFFFFFFFF)...)
+		body := append(nodeHeader, ext...)
+		body = append(body, attrBytes...)
+		header := append(u16(axmlChunkStartElement), u16(0x10)...)
+		header = append(header, u32(uint32(8+len(body)))...)
+		return append(header, body...)
+	}
+	endElem := func(name int32) []byte {
+		nodeHeader := append(u32(0), u32(0xFFFFFFFF)...)
+		ext := append(u32(0xFFFFFFFF), u32(uint32(name))...)
+		body := append(nodeHeader, ext...)
+		header := append(u16(axmlChunkEndElement), u16(0x10)...)
+		header = append(header, u32(uint32(8+len(body)))...)
+		return append(header, body...)
+	}
+
+	var doc []byte
+	doc = append(doc, axmlStringPoolChunk(strs)...)
+	doc = append(doc, startElem(idx["manifest"], [][2]int32{{idx["package"], idx["com.example.app"]}})...)
+	doc = append(doc, startElem(idx["application"], nil)...)
+	doc = append(doc, startElem(idx["activity"], [][2]int32{{idx["name"], idx["com.example.app.MainActivity"]}})...)
+	doc = append(doc, startElem(idx["intent-filter"], nil)...)
+	doc = append(doc, startElem(idx["action"], [][2]int32{{idx["name"], idx["android.intent.action.MAIN"]}})...)
+	doc = append(doc, endElem(idx["action"])...)
+	doc = append(doc, startElem(idx["category"], [][2]int32{{idx["name"], idx["android.intent.category.LAUNCHER"]}})...)
+	doc = append(doc, endElem(idx["category"])...)
+	doc = append(doc, endElem(idx["intent-filter"])...)
+	doc = append(doc, endElem(idx["activity"])...)
+	doc = append(doc, endElem(idx["application"])...)
+	doc = append(doc, endElem(idx["manifest"])...)
+
+	header := append(u16(3), u16(8)...)
+	header = append(header, u32(uint32(8+len(doc)))...)
+	data := append(header, doc...)
+
+	root, err := parseAXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _ := root.Attr("package")
+	if pkg != "com.example.app" {
+		t.Errorf("package attr = %q, want com.example.app", pkg)
+	}
+	if got := axmlMainActivity(root); got != "com.example.app.MainActivity" {
+		t.Errorf("axmlMainActivity() = %q, want com.example.app.MainActivity", got)
+	}
+}
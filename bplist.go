@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// Minimal plist readers, just enough to pull a handful of known
+// string keys out of an IPA's Info.plist, which Xcode emits as either
+// a binary plist ("bplist00") or an XML plist.
+
+// plistStrings reads the string values of keys out of the top-level
+// dictionary of a binary or XML property list.
+func plistStrings(data []byte, keys []string) (map[string]string, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		bp, err := parseBplist(data)
+		if err != nil {
+			return nil, err
+		}
+		dict, err := bp.topDict()
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]string)
+		for _, k := range keys {
+			if s, ok := dict[k].(string); ok {
+				out[k] = s
+			}
+		}
+		return out, nil
+	}
+	return parseXMLPlistStrings(data, keys)
+}
+
+// parseXMLPlistStrings streams an XML plist, pulling the string value
+// following each <key> in keys out of the (assumed flat) top-level
+// dict. Nested containers are not descended into.
+func parseXMLPlistStrings(data []byte, keys []string) (map[string]string, error) {
+	want := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		want[k] = true
+	}
+	out := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var pendingKey string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "key" {
+			var key string
+			if err := dec.DecodeElement(&key, &start); err != nil {
+				return nil, err
+			}
+			pendingKey = key
+			continue
+		}
+		if pendingKey != "" && want[pendingKey] && start.Name.Local == "string" {
+			var v string
+			if err := dec.DecodeElement(&v, &start); err != nil {
+				return nil, err
+			}
+			out[pendingKey] = v
+		}
+		pendingKey = ""
+	}
+	return out, nil
+}
+
+// bplist is a decoded binary plist's object table, addressed through
+// its offset table as described by the trailer at the end of the file.
+type bplist struct {
+	data          []byte
+	offsets       []uint64
+	objectRefSize int
+	top           int
+
+	// visiting holds the indices currently being decoded by an
+	// in-progress call to object, the same way internal/walk tracks
+	// visited directories to break symlink cycles. A ref back into
+	// this set means the object table contains a cycle.
+	visiting map[int]bool
+}
+
+func parseBplist(data []byte) (*bplist, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("bplist: file too short")
+	}
+	trailer := data[len(data)-32:]
+	offsetIntSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	numObjects := int(beUint(trailer[8:16]))
+	topObject := int(beUint(trailer[16:24]))
+	offsetTableOffset := int(beUint(trailer[24:32]))
+
+	if offsetIntSize == 0 || objectRefSize == 0 {
+		return nil, fmt.Errorf("bplist: invalid trailer")
+	}
+	if numObjects < 0 || offsetTableOffset < 0 || offsetTableOffset > len(data) ||
+		numObjects > (len(data)-offsetTableOffset)/offsetIntSize {
+		return nil, fmt.Errorf("bplist: offset table out of range")
+	}
+	offsets := make([]uint64, numObjects)
+	for i := range offsets {
+		off := offsetTableOffset + i*offsetIntSize
+		if off+offsetIntSize > len(data) {
+			return nil, fmt.Errorf("bplist: offset table out of range")
+		}
+		offsets[i] = beUint(data[off : off+offsetIntSize])
+	}
+	return &bplist{data: data, offsets: offsets, objectRefSize: objectRefSize, top: topObject}, nil
+}
+
+func beUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (p *bplist) ref(b []byte, i int) (int, error) {
+	off := i * p.objectRefSize
+	if off+p.objectRefSize > len(b) {
+		return 0, fmt.Errorf("bplist: ref table out of range")
+	}
+	return int(beUint(b[off : off+p.objectRefSize])), nil
+}
+
+// count resolves a bplist object's size nibble: a literal count, or,
+// when the nibble is 0xf, an inline int object giving the real count.
+func (p *bplist) count(info byte, body []byte) (n int, rest []byte, err error) {
+	if info != 0x0f {
+		return int(info), body, nil
+	}
+	if len(body) == 0 || body[0]>>4 != 0x1 {
+		return 0, nil, fmt.Errorf("bplist: invalid length marker")
+	}
+	size := 1 << (body[0] & 0x0f)
+	if 1+size > len(body) {
+		return 0, nil, fmt.Errorf("bplist: truncated length")
+	}
+	v := beUint(body[1 : 1+size])
+	if v > uint64(len(body)) {
+		return 0, nil, fmt.Errorf("bplist: count out of range")
+	}
+	return int(v), body[1+size:], nil
+}
+
+// object decodes the object at index idx into a nil, bool, int64,
+// float64, string, []interface{}, or map[string]interface{}.
+func (p *bplist) object(idx int) (interface{}, error) {
+	if idx < 0 || idx >= len(p.offsets) {
+		return nil, fmt.Errorf("bplist: object index out of range")
+	}
+	if p.visiting == nil {
+		p.visiting = make(map[int]bool)
+	}
+	if p.visiting[idx] {
+		return nil, fmt.Errorf("bplist: cyclic object reference")
+	}
+	p.visiting[idx] = true
+	defer delete(p.visiting, idx)
+	if p.offsets[idx] >= uint64(len(p.data)) {
+		return nil, fmt.Errorf("bplist: object offset out of range")
+	}
+	off := int(p.offsets[idx])
+	marker := p.data[off]
+	typ, info := marker>>4, marker&0x0f
+	body := p.data[off+1:]
+	switch typ {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		default:
+			return nil, nil
+		}
+	case 0x1: // int
+		n := 1 << info
+		if n > len(body) {
+			return nil, fmt.Errorf("bplist: int out of range")
+		}
+		return int64(beUint(body[:n])), nil
+	case 0x2: // real
+		n := 1 << info
+		if n > len(body) {
+			return nil, fmt.Errorf("bplist: real out of range")
+		}
+		bits := beUint(body[:n])
+		if n == 4 {
+			return float64(math.Float32frombits(uint32(bits))), nil
+		}
+		return math.Float64frombits(bits), nil
+	case 0x5: // ASCII string
+		n, body, err := p.count(info, body)
+		if err != nil {
+			return nil, err
+		}
+		if n > len(body) {
+			return nil, fmt.Errorf("bplist: string out of range")
+		}
+		return string(body[:n]), nil
+	case 0x6: // UTF-16BE string
+		n, body, err := p.count(info, body)
+		if err != nil {
+			return nil, err
+		}
+		if n*2 > len(body) {
+			return nil, fmt.Errorf("bplist: string out of range")
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(body[i*2 : i*2+2])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xA: // array
+		n, body, err := p.count(info, body)
+		if err != nil {
+			return nil, err
+		}
+		if n > len(body)/p.objectRefSize {
+			return nil, fmt.Errorf("bplist: array out of range")
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			ref, err := p.ref(body, i)
+			if err != nil {
+				return nil, err
+			}
+			v, err := p.object(ref)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case 0xD: // dict
+		n, body, err := p.count(info, body)
+		if err != nil {
+			return nil, err
+		}
+		if n > len(body)/(2*p.objectRefSize) {
+			return nil, fmt.Errorf("bplist: dict out of range")
+		}
+		out := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			kref, err := p.ref(body, i)
+			if err != nil {
+				return nil, err
+			}
+			k, err := p.object(kref)
+			if err != nil {
+				return nil, err
+			}
+			vref, err := p.ref(body[n*p.objectRefSize:], i)
+			if err != nil {
+				return nil, err
+			}
+			v, err := p.object(vref)
+			if err != nil {
+				return nil, err
+			}
+			if ks, ok := k.(string); ok {
+				out[ks] = v
+			}
+		}
+		return out, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (p *bplist) topDict() (map[string]interface{}, error) {
+	v, err := p.object(p.top)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bplist: top object is not a dict")
+	}
+	return m, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestBplistObjectPrimitives exercises int, ascii string, array, and
+// dict decoding against small, hand-built object tables.
+func TestBplistObjectPrimitives(t *testing.T) {
+	t.Run("int", func(t *testing.T) {
+		p := &bplist{data: []byte{0x10, 0x07}, offsets: []uint64{0}, objectRefSize: 1, top: 0}
+		v, err := p.object(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != int64(7) {
+			t.Errorf("got %v, want 7", v)
+		}
+	})
+
+	t.Run("ascii string", func(t *testing.T) {
+		p := &bplist{data: []byte{0x55, 'h', 'e', 'l', 'l', 'o'}, offsets: []uint64{0}, objectRefSize: 1, top: 0}
+		v, err := p.object(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "hello" {
+			t.Errorf("got %v, want hello", v)
+		}
+	})
+
+	t.Run("array", func(t *testing.T) {
+		// idx0: array [idx1, idx2] at offset 0 (marker 0xA2 + 2 one-byte refs)
+		// idx1: int 7 at offset 3; idx2: int 9 at offset 5
+		data := []byte{0xA2, 1, 2, 0x10, 0x07, 0x10, 0x09}
+		p := &bplist{data: data, offsets: []uint64{0, 3, 5}, objectRefSize: 1, top: 0}
+		v, err := p.object(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []interface{}{int64(7), int64(9)}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("got %v, want %v", v, want)
+		}
+	})
+
+	t.Run("dict", func(t *testing.T) {
+		// idx0: dict {idx1: idx2} at offset 0 (marker 0xD1 + key ref + value ref)
+		// idx1: ascii string "k" at offset 3; idx2: int 9 at offset 5
+		data := []byte{0xD1, 1, 2, 0x51, 'k', 0x10, 0x09}
+		p := &bplist{data: data, offsets: []uint64{0, 3, 5}, objectRefSize: 1, top: 0}
+		v, err := p.object(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"k": int64(9)}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("got %v, want %v", v, want)
+		}
+	})
+}
+
+// TestBplistObjectRejectsOversizedCounts crafts array/dict objects
+// that declare a huge element count relative to the remaining buffer
+// (as a malicious .ipa's Info.plist could), and requires an error
+// instead of an attempt to allocate a slice/map of that size.
+func TestBplistObjectRejectsOversizedCounts(t *testing.T) {
+	hugeCount := []byte{0x13, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff} // size=8, count=2^64-1
+
+	t.Run("array", func(t *testing.T) {
+		data := append([]byte{0xAF}, hugeCount...)
+		p := &bplist{data: data, offsets: []uint64{0}, objectRefSize: 1, top: 0}
+		if _, err := p.object(0); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("dict", func(t *testing.T) {
+		data := append([]byte{0xDF}, hugeCount...)
+		p := &bplist{data: data, offsets: []uint64{0}, objectRefSize: 1, top: 0}
+		if _, err := p.object(0); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+// TestBplistObjectRejectsHighBitOffset confirms an offset-table entry
+// above math.MaxInt64 is rejected rather than wrapping negative on
+// conversion to int and bypassing the upper-bound check.
+func TestBplistObjectRejectsHighBitOffset(t *testing.T) {
+	p := &bplist{data: []byte{0x10, 0x07}, offsets: []uint64{1<<63 + 5}, objectRefSize: 1, top: 0}
+	if _, err := p.object(0); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestBplistObjectRejectsSelfReferentialArray crafts an array whose
+// only element refs its own index, which must fail with an error
+// instead of recursing forever and crashing with a stack overflow.
+func TestBplistObjectRejectsSelfReferentialArray(t *testing.T) {
+	p := &bplist{data: []byte{0xA1, 0}, offsets: []uint64{0}, objectRefSize: 1, top: 0}
+	if _, err := p.object(0); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestBplistObjectAllowsRepeatedRef confirms two sibling entries
+// referencing the same (already-decoded, not in-progress) object is
+// still allowed, since bplists commonly dedup shared strings/values —
+// only a ref back into an object still being decoded is a cycle.
+func TestBplistObjectAllowsRepeatedRef(t *testing.T) {
+	// idx0: array [idx1, idx1] at offset 0; idx1: int 7 at offset 3.
+	data := []byte{0xA2, 1, 1, 0x10, 0x07}
+	p := &bplist{data: data, offsets: []uint64{0, 3}, objectRefSize: 1, top: 0}
+	v, err := p.object(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(7), int64(7)}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %v, want %v", v, want)
+	}
+}
+
+// TestParseBplistRejectsOversizedTrailer crafts a trailer declaring
+// far more objects than the file has room for, which must fail
+// instead of allocating an offset table sized from the attacker's
+// numObjects field.
+func TestParseBplistRejectsOversizedTrailer(t *testing.T) {
+	data := make([]byte, 40)
+	copy(data, "bplist00")
+	trailer := data[len(data)-32:]
+	trailer[6] = 1                  // offsetIntSize
+	trailer[7] = 1                  // objectRefSize
+	putBEUint(trailer[8:16], 1<<32) // numObjects: absurd relative to 40-byte file
+	putBEUint(trailer[16:24], 0)    // topObject
+	putBEUint(trailer[24:32], 8)    // offsetTableOffset
+
+	if _, err := parseBplist(data); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func putBEUint(b []byte, v uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
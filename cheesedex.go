@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"embed"
-	"errors"
 	"flag"
 	"fmt"
 	"html"
@@ -16,18 +15,18 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"os"
 	"path"
-	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	mdhtml "github.com/yuin/goldmark/renderer/html"
-	"samhza.com/cheesedex/internal/walk"
 )
 
 //go:embed *.html
@@ -50,32 +49,72 @@ func init() {
 
 func main() {
 	addr := flag.String("a", ":6060", "listen address")
-	dir := flag.String("d", ".", "directory to serve")
+	dir := flag.String("d", ".", "directory, zip archive, or tar.gz archive to serve")
+	config := flag.String("config", "", "path to a YAML/JSON file granting upload/delete ACLs")
+	reindex := flag.Duration("reindex", 5*time.Minute, "how often to rebuild the search index")
 	flag.Parse()
-	err := http.ListenAndServe(*addr, &Server{*dir})
+	store, err := newStore(*dir)
+	if err != nil {
+		log.Fatalln("opening store:", err)
+	}
+	idx := newIndex(store, *reindex)
+	go idx.run()
+	srv := &Server{store: store, index: idx}
+	if *config != "" {
+		srv.acl, err = loadACLConfig(*config)
+		if err != nil {
+			log.Fatalln("loading -config:", err)
+		}
+	}
+	err = http.ListenAndServe(*addr, srv)
 	if err != nil {
 		log.Fatalln(err)
 	}
 }
 
 type Server struct {
-	dir string
+	store Store
+	acl   *ACLConfig
+	index *Index
+
+	metaMu    sync.Mutex
+	metaCache map[metaCacheKey]*PackageMeta
+
+	shaMu    sync.Mutex
+	shaCache map[metaCacheKey]string
+}
+
+// fsName converts a URL path, as produced by path.Clean(r.URL.Path),
+// into the slash-separated, leading-slash-free form Store methods use.
+func fsName(relpath string) string {
+	name := strings.TrimPrefix(relpath, "/")
+	if name == "" {
+		return "."
+	}
+	return name
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	relpath := path.Clean(r.URL.Path)
 	switch r.Method {
 	case http.MethodGet, http.MethodHead:
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		s.handleWrite(w, r, relpath)
+		return
 	default:
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
 			http.StatusMethodNotAllowed)
 		return
 	}
+	if strings.HasPrefix(relpath, ipaPlistPrefix) {
+		s.handleIPAPlist(w, r, strings.TrimPrefix(relpath, ipaPlistPrefix))
+		return
+	}
 	if dir := r.URL.Query().Get("dir"); dir != "" {
 		http.Redirect(w, r, "/"+dir, http.StatusTemporaryRedirect)
 		return
 	}
-	relpath := path.Clean(r.URL.Path)
-	file, err := os.Open(path.Join(s.dir, relpath))
+	file, err := s.store.Open(fsName(relpath))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -89,88 +128,159 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if stat.IsDir() {
 		if query := r.URL.Query().Get("q"); query != "" {
 			isregexp := r.URL.Query().Get("regexp") == "on"
-			s.handleSearch(w, relpath, query, isregexp)
+			s.handleSearch(w, r, relpath, query, isregexp)
 			return
 		}
-		s.handleDir(r, w, file, relpath)
+		s.handleDir(r, w, relpath)
+		return
+	}
+	if r.URL.Query().Get("meta") == "1" {
+		s.handleFileMeta(w, relpath, stat)
+		return
+	}
+	if r.URL.Query().Get("edit") == "1" {
+		s.handleEdit(w, r, relpath)
 		return
 	}
-	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+	rs, err := asReadSeeker(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), rs)
 }
 
 type SearchContext struct {
-	Name    string
-	Path    string
-	Query   string
-	Results <-chan FileInfo
-	Banner  *Banner
+	Name     string
+	Path     string
+	HREFPath string
+	Query    string
+	IsRegexp bool
+	Mode     string
+	Results  []FileInfo
+	Page     int
+	Limit    int
+	Total    int
+	HasPrev  bool
+	HasNext  bool
+	PrevPage int
+	NextPage int
+	Banner   *Banner
 }
 
-func (s *Server) handleSearch(w http.ResponseWriter,
+// handleSearch answers a ?q= search by scanning the background
+// search index snapshot rather than walking the store. query is
+// split into plain terms plus any size:, ext:, and modified: filters;
+// ?mode=glob treats the remaining terms as a path.Match pattern, and
+// ?regexp=on (isregexp) treats them as a regexp matched against the
+// full path. Matches are scored (exact name > prefix > substring >
+// path) and paginated with ?page= and ?limit=.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request,
 	relpath, query string, isregexp bool) {
+	terms, filt := parseQuery(query)
+	term := strings.Join(terms, " ")
 	var exp *regexp.Regexp
-	var lowerq string
-	if isregexp {
+	var glob string
+	switch {
+	case isregexp:
 		var err error
-		exp, err = regexp.Compile(query)
+		exp, err = regexp.Compile(term)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-	} else {
-		lowerq = strings.ToLower(query)
+	case r.URL.Query().Get("mode") == "glob":
+		glob = term
 	}
-	results := make(chan FileInfo)
-	basepath := path.Join(s.dir, relpath)
-	fn := func(fpath string, getinfo func() (fs.FileInfo, error), err error) error {
-		switch {
-		case errors.Is(err, os.ErrPermission):
-		case err == nil:
-		default:
-			return err
-		}
-		name, err := filepath.Rel(basepath, fpath)
-		if err != nil {
-			panic("impossible")
-		}
-		if name == "." {
-			return nil
+
+	basepath := fsName(relpath)
+	prefix := basepath + "/"
+	if basepath == "." {
+		prefix = ""
+	}
+
+	type scored struct {
+		entry IndexEntry
+		score int
+	}
+	var matches []scored
+	for _, e := range s.index.snapshot() {
+		if prefix != "" && !strings.HasPrefix(e.Path, prefix) {
+			continue
 		}
-		var matched bool
-		if exp != nil {
-			matched = exp.MatchString(fpath)
-		} else {
-			_, name := path.Split(name)
-			matched = strings.Contains(strings.ToLower(name), lowerq)
+		if !filt.match(e) {
+			continue
 		}
-		if !matched {
-			return nil
+		score, ok := scoreEntry(e, terms, exp, glob)
+		if !ok {
+			continue
 		}
-		info, err := getinfo()
-		if err != nil {
-			return err
+		matches = append(matches, scored{e, score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
 		}
-		var finfo FileInfo
-		finfo.PopulateFrom(fpath, info)
-		finfo.path = name
-		results <- finfo
-		return nil
+		return matches[i].entry.Path < matches[j].entry.Path
+	})
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
 	}
-	go func() {
-		err := walk.WalkDir(path.Join(s.dir, relpath), fn)
-		if err != nil {
-			log.Println("error encountered searching:", err)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	start := (page - 1) * limit
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	if wantsJSON(r) {
+		entries := make([]IndexEntry, len(matches[start:end]))
+		for i, m := range matches[start:end] {
+			entries[i] = m.entry
 		}
-		close(results)
-	}()
+		serveSearchJSON(w, entries)
+		return
+	}
+
+	hrefPath := relpath
+	if hrefPath != "/" {
+		hrefPath += "/"
+	}
 	ctx := SearchContext{
-		Name:    query,
-		Path:    relpath,
-		Query:   query,
-		Results: results,
+		Name:     query,
+		Path:     relpath,
+		HREFPath: hrefPath,
+		Query:    query,
+		IsRegexp: isregexp,
+		Mode:     r.URL.Query().Get("mode"),
+		Page:     page,
+		Limit:    limit,
+		Total:    len(matches),
+		HasPrev:  page > 1,
+		HasNext:  end < len(matches),
+		PrevPage: page - 1,
+		NextPage: page + 1,
+	}
+	for _, m := range matches[start:end] {
+		fi := FileInfo{path: strings.TrimPrefix(m.entry.Path, prefix)}
+		fi.PopulateFrom(s.store, m.entry.Path, indexFileInfo{
+			name: m.entry.Name,
+			size: m.entry.Size,
+			mode: m.entry.Mode,
+			mod:  m.entry.ModTime,
+		})
+		ctx.Results = append(ctx.Results, fi)
 	}
 	var err error
-	ctx.Banner, err = banner(path.Join(s.dir, "banners"))
+	ctx.Banner, err = banner(s.store, "banners")
 	if err != nil {
 		log.Println("getting random banner:", err.Error())
 	}
@@ -183,17 +293,18 @@ func (s *Server) handleSearch(w http.ResponseWriter,
 }
 
 type IndexContext struct {
-	Name   string
-	Path   string
-	Files  []FileInfo
-	ReadMe *template.HTML
-	Root   bool
-	Banner *Banner
+	Name      string
+	Path      string
+	Files     []FileInfo
+	ReadMe    *template.HTML
+	Root      bool
+	Banner    *Banner
+	CanUpload bool
+	CanDelete bool
 }
 
 // handleDir display's a directory's file index, or returns an archive
-func (s *Server) handleDir(r *http.Request, w http.ResponseWriter,
-	file *os.File, relpath string) {
+func (s *Server) handleDir(r *http.Request, w http.ResponseWriter, relpath string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
 			http.StatusMethodNotAllowed)
@@ -212,10 +323,10 @@ func (s *Server) handleDir(r *http.Request, w http.ResponseWriter,
 		switch dl {
 		case "targz":
 			w.Header().Set("Content-Disposition", "attachment; filename="+dirname+".tar.gz")
-			err = archiveTarGZ(path.Join(s.dir, relpath), w)
+			err = s.archiveTarGZ(relpath, w)
 		case "zip":
 			w.Header().Set("Content-Disposition", "attachment; filename="+dirname+".zip")
-			err = archiveZIP(path.Join(s.dir, relpath), w)
+			err = s.archiveZIP(relpath, w)
 		default:
 			http.Error(w, "dl must be one of 'targz', 'zip'", http.StatusBadRequest)
 			return
@@ -225,34 +336,72 @@ func (s *Server) handleDir(r *http.Request, w http.ResponseWriter,
 		}
 		return
 	}
-	files, err := file.Readdir(0)
+	files, err := s.store.ReadDir(fsName(relpath))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if wantsJSON(r) {
+		if err := s.serveDirJSON(w, files, relpath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 	for _, file := range files {
 		if file.Name() == "index.html" {
-			http.ServeFile(w, r, path.Join(s.dir, relpath, "index.html"))
+			f, err := s.store.Open(path.Join(fsName(relpath), "index.html"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			stat, err := f.Stat()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rs, err := asReadSeeker(f)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, stat.Name(), stat.ModTime(), rs)
 			return
 		}
 	}
 	dir := new(IndexContext)
-	err = dir.Populate(files, relpath, s.dir)
+	err = dir.Populate(s, r, files, relpath)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	perms := s.acl.Perms(relpath)
+	dir.CanUpload, dir.CanDelete = perms.Upload, perms.Delete
 	err = tmpl.ExecuteTemplate(w, "dir.html", dir)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-// archiveZIP writes a zip archive of root to wr.
-func archiveZIP(root string, wr io.Writer) error {
+// archiveZIP writes a zip archive of relpath to wr. If the whole tree
+// is requested and the store is itself a zip archive, the source file
+// is streamed straight through instead of being re-compressed.
+func (s *Server) archiveZIP(relpath string, wr io.Writer) error {
+	if zs, ok := s.store.(zipStore); ok && fsName(relpath) == "." {
+		f, err := fsOpenRaw(zs.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(wr, f)
+		return err
+	}
+	fsys, err := fs.Sub(s.store, fsName(relpath))
+	if err != nil {
+		return err
+	}
 	w := zip.NewWriter(wr)
-	fsys := os.DirFS(root)
-	err := fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -286,12 +435,27 @@ func archiveZIP(root string, wr io.Writer) error {
 	return w.Close()
 }
 
-// archiveTarGZ writes a gzipped tar archive of root to wr.
-func archiveTarGZ(root string, wr io.Writer) error {
+// archiveTarGZ writes a gzipped tar archive of relpath to wr. If the
+// whole tree is requested and the store is itself a tar.gz archive,
+// the source file is streamed straight through instead of being
+// re-compressed.
+func (s *Server) archiveTarGZ(relpath string, wr io.Writer) error {
+	if ts, ok := s.store.(*tarGZStore); ok && fsName(relpath) == "." {
+		f, err := fsOpenRaw(ts.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(wr, f)
+		return err
+	}
+	fsys, err := fs.Sub(s.store, fsName(relpath))
+	if err != nil {
+		return err
+	}
 	zw := gzip.NewWriter(wr)
 	w := tar.NewWriter(zw)
-	fsys := os.DirFS(root)
-	err := fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -333,6 +497,11 @@ type FileInfo struct {
 	fs.FileInfo
 	path       string
 	TargetMode fs.FileMode
+
+	// Package is set for .apk/.ipa files once their manifest has been
+	// parsed; see Server.packageMeta.
+	Package     *PackageMeta
+	InstallHREF template.URL
 }
 
 func (f FileInfo) RelPath() string {
@@ -370,10 +539,18 @@ func (f FileInfo) mode() fs.FileMode {
 	return f.Mode()
 }
 
-func (f *FileInfo) PopulateFrom(fpath string, i fs.FileInfo) error {
+func (f *FileInfo) PopulateFrom(store Store, fpath string, i fs.FileInfo) error {
 	f.FileInfo = i
 	if f.Mode().Type() == fs.ModeSymlink {
-		stat, err := os.Stat(fpath)
+		link, err := store.Readlink(fpath)
+		if err != nil {
+			return err
+		}
+		target := link
+		if !path.IsAbs(link) {
+			target = path.Join(path.Dir(fpath), link)
+		}
+		stat, err := store.Stat(fsName(target))
 		if err != nil {
 			return err
 		}
@@ -399,12 +576,28 @@ func Crumbs(dirpath string) []Crumb {
 	return crumbs
 }
 
-func (d *IndexContext) Populate(
-	files []fs.FileInfo, dirpath, root string) error {
+func (d *IndexContext) Populate(s *Server, r *http.Request, files []fs.DirEntry, dirpath string) error {
+	store := s.store
 	d.Files = make([]FileInfo, len(files))
 	for i, f := range files {
-		d.Files[i].PopulateFrom(
-			path.Join(root, dirpath, f.Name()), f)
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+		fpath := path.Join(fsName(dirpath), f.Name())
+		d.Files[i].PopulateFrom(store, fpath, info)
+		switch strings.ToLower(path.Ext(f.Name())) {
+		case ".apk", ".ipa":
+			meta, err := s.packageMeta(fpath)
+			if err != nil {
+				log.Println("reading package metadata:", err)
+				continue
+			}
+			d.Files[i].Package = meta
+			if meta.Kind == "ipa" {
+				d.Files[i].InstallHREF = template.URL(installHREF(r, "/"+fpath))
+			}
+		}
 	}
 	_, d.Name = path.Split(dirpath)
 	sort.Slice(d.Files, func(i, j int) bool {
@@ -423,29 +616,30 @@ func (d *IndexContext) Populate(
 		d.Root = true
 	}
 	var err error
-	d.Banner, err = banner(path.Join(root, "banners"))
+	d.Banner, err = banner(store, "banners")
 	if err != nil {
 		log.Println("getting random banner:", err.Error())
 	}
 
 	for _, finfo := range d.Files {
+		readmePath := path.Join(fsName(dirpath), finfo.Name())
 		switch strings.ToLower(finfo.Name()) {
 		case "readme.txt":
-			p, err := os.ReadFile(path.Join(root, dirpath, finfo.Name()))
+			p, err := readAll(store, readmePath)
 			if err != nil {
 				return err
 			}
 			escaped := template.HTML("<pre>" + html.EscapeString(string(p)) + "</pre>")
 			d.ReadMe = &escaped
 		case "readme.html":
-			p, err := os.ReadFile(path.Join(root, dirpath, finfo.Name()))
+			p, err := readAll(store, readmePath)
 			if err != nil {
 				return err
 			}
 			escaped := template.HTML(p)
 			d.ReadMe = &escaped
 		case "readme.md":
-			p, err := os.ReadFile(path.Join(root, dirpath, finfo.Name()))
+			p, err := readAll(store, readmePath)
 			if err != nil {
 				return err
 			}
@@ -472,8 +666,18 @@ type Banner struct {
 	ImageURL, Link string
 }
 
-func banner(path string) (*Banner, error) {
-	p, err := os.ReadFile(path)
+// readAll reads the whole contents of name out of store.
+func readAll(store Store, name string) ([]byte, error) {
+	f, err := store.Open(fsName(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func banner(store Store, name string) (*Banner, error) {
+	p, err := readAll(store, name)
 	if err != nil {
 		return nil, fmt.Errorf("reading file: %w", err)
 	}
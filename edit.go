@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// editorMode returns the CodeMirror/Monaco mode name for a file
+// extension, defaulting to plain text.
+func editorMode(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".md", ".markdown":
+		return "markdown"
+	case ".yml", ".yaml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".json":
+		return "json"
+	case ".go":
+		return "go"
+	case ".html", ".htm":
+		return "htmlmixed"
+	case ".js":
+		return "javascript"
+	case ".css":
+		return "css"
+	case ".sh":
+		return "shell"
+	default:
+		return "text/plain"
+	}
+}
+
+// frontmatterFences maps a recognized opening fence to its format
+// name and closing fence.
+var frontmatterFences = []struct{ open, close, format string }{
+	{"---\n", "---\n", "yaml"},
+	{"+++\n", "+++\n", "toml"},
+}
+
+// splitFrontmatter splits data into a leading frontmatter fence and
+// the remaining body. ok is false if data has no recognized fence.
+func splitFrontmatter(data []byte) (format, fm, body string, ok bool) {
+	for _, fence := range frontmatterFences {
+		if !bytes.HasPrefix(data, []byte(fence.open)) {
+			continue
+		}
+		rest := data[len(fence.open):]
+		idx := bytes.Index(rest, []byte("\n"+fence.close))
+		if idx < 0 {
+			continue
+		}
+		return fence.format, string(rest[:idx]), string(rest[idx+1+len(fence.close):]), true
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == nil {
+			return "json", string(raw), string(data[dec.InputOffset():]), true
+		}
+	}
+	return "", "", "", false
+}
+
+// joinFrontmatter reassembles fm and body using the fence style
+// named by format, the inverse of splitFrontmatter.
+func joinFrontmatter(format, fm, body string) string {
+	switch format {
+	case "yaml":
+		return "---\n" + strings.Trim(fm, "\n") + "\n---\n" + body
+	case "toml":
+		return "+++\n" + strings.Trim(fm, "\n") + "\n+++\n" + body
+	case "json":
+		return fm + body
+	default:
+		return body
+	}
+}
+
+func unmarshalFrontmatter(format, fm string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal([]byte(fm), &m)
+	case "toml":
+		err = toml.Unmarshal([]byte(fm), &m)
+	case "json":
+		err = json.Unmarshal([]byte(fm), &m)
+	default:
+		return nil, fmt.Errorf("unknown frontmatter format %q", format)
+	}
+	return m, err
+}
+
+// frontmatterIsScalar reports whether v is a plain string, number,
+// bool, or null — the value types the editor's <input type="text">
+// fields can round-trip safely. Lists and nested maps, common in YAML
+// frontmatter (tags: [go, web]), and types like time.Time that YAML
+// produces for unquoted date/timestamp scalars, would be mangled by a
+// flat text input, so handleEdit renders those read-only instead.
+func frontmatterIsScalar(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Invalid, reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// coerceFrontmatterScalar converts posted — always a JSON string, since
+// every editor <input type="text"> field reads back as plain text —
+// to the type orig had on disk, using orig as a type hint. This is
+// what lets a number or bool round-trip through the editor without
+// turning into a quoted string on save. If posted isn't a string, or
+// doesn't parse as orig's type, it's returned unchanged.
+func coerceFrontmatterScalar(orig, posted interface{}) interface{} {
+	s, ok := posted.(string)
+	if !ok {
+		return posted
+	}
+	switch orig.(type) {
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case int:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return int(n)
+		}
+	case int64:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return posted
+}
+
+func marshalFrontmatter(format string, m map[string]interface{}) (string, error) {
+	switch format {
+	case "yaml":
+		b, err := yaml.Marshal(m)
+		return string(b), err
+	case "toml":
+		var sb strings.Builder
+		err := toml.NewEncoder(&sb).Encode(m)
+		return sb.String(), err
+	case "json":
+		b, err := json.MarshalIndent(m, "", "  ")
+		return string(b), err
+	default:
+		return "", fmt.Errorf("unknown frontmatter format %q", format)
+	}
+}
+
+// EditContext is the template context for the ?edit=1 editor page.
+type EditContext struct {
+	Name, Path        string
+	Mode              string
+	Body              string
+	Frontmatter       map[string]interface{}
+	FrontmatterFormat string
+	// FrontmatterRaw holds the marshaled text of each non-scalar
+	// Frontmatter value, keyed by its frontmatter key. edit.html
+	// renders these keys read-only instead of as editable inputs.
+	FrontmatterRaw map[string]string
+	ModTime        time.Time
+}
+
+// handleEdit serves the ?edit=1 editor page for relpath.
+func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request, relpath string) {
+	data, err := readAll(s.store, relpath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	stat, err := s.store.Stat(fsName(relpath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx := &EditContext{
+		Path:    relpath,
+		Mode:    editorMode(filepath.Ext(relpath)),
+		Body:    string(data),
+		ModTime: stat.ModTime(),
+	}
+	_, ctx.Name = path.Split(relpath)
+	if format, fm, body, ok := splitFrontmatter(data); ok {
+		if m, err := unmarshalFrontmatter(format, fm); err == nil {
+			ctx.FrontmatterFormat = format
+			ctx.Frontmatter = m
+			ctx.Body = body
+			ctx.FrontmatterRaw = make(map[string]string)
+			for k, v := range m {
+				if frontmatterIsScalar(v) {
+					continue
+				}
+				if raw, err := marshalFrontmatter(format, map[string]interface{}{k: v}); err == nil {
+					ctx.FrontmatterRaw[k] = raw
+				}
+			}
+		}
+	}
+	err = tmpl.ExecuteTemplate(w, "edit.html", ctx)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// handleEditSave writes the body posted by the ?edit=1 page back to
+// relpath, reassembling any frontmatter, and atomically overwrites
+// the file. It refuses to save if the file's mtime has moved past
+// the If-Unmodified-Since header the page was loaded with.
+func (s *Server) handleEditSave(w http.ResponseWriter, r *http.Request, relpath string) {
+	dir, _ := localDir(s.store)
+	target := path.Join(dir, relpath)
+	stat, err := os.Stat(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		t, err := http.ParseTime(ius)
+		if err != nil {
+			http.Error(w, "invalid If-Unmodified-Since", http.StatusBadRequest)
+			return
+		}
+		if stat.ModTime().Truncate(time.Second).After(t) {
+			http.Error(w, "file changed since it was loaded", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	var payload struct {
+		Format      string                 `json:"format"`
+		Frontmatter map[string]interface{} `json:"frontmatter"`
+		Body        string                 `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content := payload.Body
+	if payload.Format != "" {
+		fm := payload.Frontmatter
+		if fm == nil {
+			fm = make(map[string]interface{})
+		}
+		// Non-scalar frontmatter values are rendered read-only by
+		// edit.html and never appear in the posted payload; restore
+		// them from the file's current frontmatter so a save can't
+		// drop or flatten them. Scalar values do appear in the
+		// payload, but every <input type="text"> reads back as a
+		// plain string, so coerce each back to the type it had on
+		// disk. The If-Unmodified-Since check above already
+		// guarantees target still holds what the editor loaded, so
+		// any failure here is unexpected and must fail the save
+		// rather than silently write it back wrong.
+		if orig, err := os.ReadFile(target); err == nil {
+			if format, origFM, _, ok := splitFrontmatter(orig); ok {
+				if format != payload.Format {
+					http.Error(w, "frontmatter format changed since the file was loaded", http.StatusConflict)
+					return
+				}
+				origMap, err := unmarshalFrontmatter(format, origFM)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for k, v := range origMap {
+					if !frontmatterIsScalar(v) {
+						fm[k] = v
+						continue
+					}
+					if posted, ok := fm[k]; ok {
+						fm[k] = coerceFrontmatterScalar(v, posted)
+					}
+				}
+			}
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmStr, err := marshalFrontmatter(payload.Format, fm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content = joinFrontmatter(payload.Format, fmStr, payload.Body)
+	}
+	if err := writeFileAtomic(target, strings.NewReader(content)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"samhza.com/cheesedex/internal/walk"
+)
+
+// IndexEntry is one file or directory's record in the search index.
+type IndexEntry struct {
+	Path    string
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+}
+
+// Index is a background-built, periodically refreshed snapshot of
+// every entry under a Store, so searches scan memory instead of
+// walking the store (disk or archive) on every query.
+type Index struct {
+	store    Store
+	interval time.Duration
+
+	mu      sync.RWMutex
+	entries []IndexEntry
+}
+
+// newIndex builds an Index over store, rebuilding every interval.
+// The first build happens synchronously so the index is never empty
+// while the server is up; call run in a goroutine to keep it fresh.
+func newIndex(store Store, interval time.Duration) *Index {
+	idx := &Index{store: store, interval: interval}
+	idx.rebuild()
+	return idx
+}
+
+// run rebuilds the index every idx.interval. It never returns.
+func (idx *Index) run() {
+	t := time.NewTicker(idx.interval)
+	defer t.Stop()
+	for range t.C {
+		idx.rebuild()
+	}
+}
+
+func (idx *Index) rebuild() {
+	var entries []IndexEntry
+	err := walk.WalkDir(idx.store, ".", func(fpath string, getinfo func() (fs.FileInfo, error), err error) error {
+		if errors.Is(err, fs.ErrPermission) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fpath == "." {
+			return nil
+		}
+		info, err := getinfo()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, IndexEntry{
+			Path:    fpath,
+			Name:    path.Base(fpath),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode(),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Println("rebuilding search index:", err)
+		return
+	}
+	idx.mu.Lock()
+	idx.entries = entries
+	idx.mu.Unlock()
+}
+
+// snapshot returns the index's current entries. The slice is never
+// modified in place; rebuild swaps in a wholly new one.
+func (idx *Index) snapshot() []IndexEntry {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.entries
+}
+
+// searchFilter holds the size:, ext:, and modified: constraints
+// parsed out of a search query.
+type searchFilter struct {
+	minSize, maxSize              int64
+	ext                           string
+	modifiedAfter, modifiedBefore time.Time
+}
+
+func (f searchFilter) match(e IndexEntry) bool {
+	if f.minSize > 0 && e.Size < f.minSize {
+		return false
+	}
+	if f.maxSize > 0 && e.Size > f.maxSize {
+		return false
+	}
+	if f.ext != "" && !strings.EqualFold(strings.TrimPrefix(path.Ext(e.Name), "."), f.ext) {
+		return false
+	}
+	if !f.modifiedAfter.IsZero() && e.ModTime.Before(f.modifiedAfter) {
+		return false
+	}
+	if !f.modifiedBefore.IsZero() && e.ModTime.After(f.modifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// parseQuery splits raw into its plain search terms and its size:,
+// ext:, and modified: filters.
+func parseQuery(raw string) (terms []string, filt searchFilter) {
+	for _, tok := range strings.Fields(raw) {
+		switch {
+		case strings.HasPrefix(tok, "size:"):
+			parseSizeFilter(strings.TrimPrefix(tok, "size:"), &filt)
+		case strings.HasPrefix(tok, "ext:"):
+			filt.ext = strings.TrimPrefix(tok, "ext:")
+		case strings.HasPrefix(tok, "modified:"):
+			parseModifiedFilter(strings.TrimPrefix(tok, "modified:"), &filt)
+		default:
+			terms = append(terms, tok)
+		}
+	}
+	return terms, filt
+}
+
+func parseSizeFilter(s string, filt *searchFilter) {
+	op := byte('>')
+	if len(s) > 0 && (s[0] == '>' || s[0] == '<') {
+		op = s[0]
+		s = s[1:]
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return
+	}
+	if op == '>' {
+		filt.minSize = int64(n)
+	} else {
+		filt.maxSize = int64(n)
+	}
+}
+
+func parseModifiedFilter(s string, filt *searchFilter) {
+	op := byte('<')
+	if len(s) > 0 && (s[0] == '>' || s[0] == '<') {
+		op = s[0]
+		s = s[1:]
+	}
+	d, err := parseRelativeDuration(s)
+	if err != nil {
+		return
+	}
+	t := time.Now().Add(-d)
+	if op == '<' {
+		filt.modifiedAfter = t
+	} else {
+		filt.modifiedBefore = t
+	}
+}
+
+// parseRelativeDuration parses durations like "7d", "3w", "12h".
+func parseRelativeDuration(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, err
+	}
+	switch s[len(s)-1] {
+	case 'h':
+		return time.Duration(n) * time.Hour, nil
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, nil
+	case 'w':
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown duration unit in %q", s)
+	}
+}
+
+// indexFileInfo adapts an IndexEntry into an fs.FileInfo so search
+// results can reuse the FileInfo template helpers.
+type indexFileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+	mod  time.Time
+}
+
+func (i indexFileInfo) Name() string       { return i.name }
+func (i indexFileInfo) Size() int64        { return i.size }
+func (i indexFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i indexFileInfo) ModTime() time.Time { return i.mod }
+func (i indexFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i indexFileInfo) Sys() interface{}   { return nil }
+
+// match scoring: exact name match beats prefix, which beats
+// substring, which beats a match only found in the path.
+const (
+	scorePath = iota + 1
+	scoreSubstring
+	scorePrefix
+	scoreExact
+)
+
+func scoreEntry(e IndexEntry, terms []string, exp *regexp.Regexp, glob string) (int, bool) {
+	switch {
+	case exp != nil:
+		if exp.MatchString(e.Path) {
+			return scorePath, true
+		}
+	case glob != "":
+		if ok, _ := path.Match(glob, e.Name); ok {
+			return scoreExact, true
+		}
+		if ok, _ := path.Match(glob, e.Path); ok {
+			return scorePath, true
+		}
+	case len(terms) > 0:
+		q := strings.ToLower(strings.Join(terms, " "))
+		name := strings.ToLower(e.Name)
+		switch {
+		case name == q:
+			return scoreExact, true
+		case strings.HasPrefix(name, q):
+			return scorePrefix, true
+		case strings.Contains(name, q):
+			return scoreSubstring, true
+		case strings.Contains(strings.ToLower(e.Path), q):
+			return scorePath, true
+		}
+	default:
+		return scorePath, true
+	}
+	return 0, false
+}
@@ -2,24 +2,32 @@ package walk
 
 import (
 	"io/fs"
-	"os"
 	"path"
 )
 
+// FS is the minimal interface WalkDir needs to traverse a tree. Any
+// Store in package main (local filesystem or archive-backed) already
+// implements it.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Readlink(name string) (string, error)
+}
+
 type WalkDirFunc func(path string, info func() (fs.FileInfo, error), err error) error
 
-func WalkDir(root string, fn WalkDirFunc) error {
+func WalkDir(fsys FS, root string, fn WalkDirFunc) error {
 	visited := make(map[string]struct{})
-	info, err := os.Stat(root)
+	info, err := fsys.Stat(root)
 	if err != nil {
 		err = fn(root, nil, err)
 	} else {
-		err = walkDir(root, &statDirEntry{info}, visited, fn)
+		err = walkDir(fsys, root, &statDirEntry{info}, visited, fn)
 	}
 	return err
 }
 
-func walkDir(name string, d fs.DirEntry, visited map[string]struct{}, fn WalkDirFunc) error {
+func walkDir(fsys FS, name string, d fs.DirEntry, visited map[string]struct{}, fn WalkDirFunc) error {
 	realname := name
 	var stat fs.FileInfo
 	willwalk := func() bool {
@@ -28,7 +36,7 @@ func walkDir(name string, d fs.DirEntry, visited map[string]struct{}, fn WalkDir
 			return !ok
 		}
 		if d.Type() == fs.ModeSymlink {
-			link, err := os.Readlink(name)
+			link, err := fsys.Readlink(name)
 			if err != nil {
 				return false
 			}
@@ -41,7 +49,7 @@ func walkDir(name string, d fs.DirEntry, visited map[string]struct{}, fn WalkDir
 			if ok {
 				return false
 			}
-			if finfo, err := os.Stat(realname); err != nil {
+			if finfo, err := fsys.Stat(realname); err != nil {
 				return false
 			} else {
 				return finfo.IsDir()
@@ -54,28 +62,28 @@ func walkDir(name string, d fs.DirEntry, visited map[string]struct{}, fn WalkDir
 			return stat, nil
 		}
 		var err error
-		stat, err = os.Stat(name)
+		stat, err = fsys.Stat(name)
 		return stat, err
 	}
 	if err := fn(name, getinfo, nil); err != nil || !willwalk() {
-		if err == fs.SkipDir && stat.IsDir() {
+		if err == fs.SkipDir && stat != nil && stat.IsDir() {
 			err = nil
 		}
 		return err
 	}
 	visited[realname] = struct{}{}
 
-	dirs, err := os.ReadDir(name)
+	entries, err := fsys.ReadDir(name)
 	if err != nil {
-		err = fn(name, d.Info, err)
+		err = fn(name, getinfo, err)
 		if err != nil {
 			return err
 		}
 	}
 
-	for _, d1 := range dirs {
+	for _, d1 := range entries {
 		name1 := path.Join(name, d1.Name())
-		if err := walkDir(name1, d1, visited, fn); err != nil {
+		if err := walkDir(fsys, name1, d1, visited, fn); err != nil {
 			if err == fs.SkipDir {
 				break
 			}
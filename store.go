@@ -0,0 +1,289 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store abstracts the tree cheesedex serves. Paths passed to its
+// methods are slash-separated and relative to the store's root, as
+// with io/fs. It is satisfied by the local filesystem and by zip and
+// tar.gz archives, so the rest of the server (listings, search,
+// README rendering, range downloads) works the same over either.
+type Store interface {
+	fs.FS
+	fs.StatFS
+	fs.ReadDirFS
+	Readlink(name string) (string, error)
+}
+
+// newStore opens the Store for dir: a zip or tar.gz archive if dir
+// has one of those extensions, otherwise the local filesystem.
+func newStore(dir string) (Store, error) {
+	switch {
+	case strings.HasSuffix(dir, ".zip"):
+		return newZipStore(dir)
+	case strings.HasSuffix(dir, ".tar.gz"), strings.HasSuffix(dir, ".tgz"):
+		return newTarGZStore(dir)
+	default:
+		return fsStore{os.DirFS(dir), dir}, nil
+	}
+}
+
+// localDir returns the real filesystem directory backing st, for
+// handlers that need to write to it. Archive-backed stores are
+// read-only and return ok == false.
+func localDir(st Store) (dir string, ok bool) {
+	fs, ok := st.(fsStore)
+	return fs.dir, ok
+}
+
+// fsStore serves a Store out of the local filesystem rooted at dir.
+type fsStore struct {
+	fs.FS
+	dir string
+}
+
+func (s fsStore) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(s.FS, name) }
+func (s fsStore) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(s.FS, name) }
+func (s fsStore) Readlink(name string) (string, error) {
+	return os.Readlink(path.Join(s.dir, name))
+}
+
+// zipStore serves a Store directly out of a zip archive opened once
+// at startup. archive/zip.Reader only implements fs.FS (Open); Stat
+// and ReadDir are provided here via the generic io/fs helpers.
+type zipStore struct {
+	*zip.Reader
+	path string
+}
+
+func newZipStore(p string) (Store, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	return zipStore{&zr.Reader, p}, nil
+}
+
+func (s zipStore) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(s.Reader, name) }
+func (s zipStore) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(s.Reader, name) }
+
+func (s zipStore) Readlink(name string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+// tarGZStore serves a Store out of a gzipped tar archive, indexed
+// into memory once at startup since tar, unlike zip, has no central
+// directory to seek to.
+type tarGZStore struct {
+	path     string
+	entries  map[string]*tarEntry
+	children map[string][]string
+}
+
+type tarEntry struct {
+	info fs.FileInfo
+	link string
+	data []byte
+}
+
+func newTarGZStore(p string) (Store, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	st := &tarGZStore{
+		path:     p,
+		entries:  map[string]*tarEntry{".": {info: tarDirInfo(".")}},
+		children: map[string][]string{},
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := cleanFSPath(hdr.Name)
+		if name == "." {
+			continue
+		}
+		var data []byte
+		if hdr.Typeflag == tar.TypeReg {
+			if data, err = io.ReadAll(tr); err != nil {
+				return nil, err
+			}
+		}
+		st.addEntry(name, &tarEntry{info: hdr.FileInfo(), link: hdr.Linkname, data: data})
+	}
+	return st, nil
+}
+
+// addEntry records name and, if missing, synthesizes any of its
+// ancestor directories so ReadDir works all the way up to the root.
+func (s *tarGZStore) addEntry(name string, e *tarEntry) {
+	s.entries[name] = e
+	for name != "." {
+		dir := cleanFSPath(path.Dir(name))
+		base := path.Base(name)
+		if _, ok := s.entries[dir]; !ok {
+			s.entries[dir] = &tarEntry{info: tarDirInfo(path.Base(dir))}
+		}
+		found := false
+		for _, c := range s.children[dir] {
+			if c == base {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.children[dir] = append(s.children[dir], base)
+		}
+		name = dir
+	}
+}
+
+func (s *tarGZStore) Stat(name string) (fs.FileInfo, error) {
+	e, ok := s.entries[cleanFSPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return e.info, nil
+}
+
+func (s *tarGZStore) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = cleanFSPath(name)
+	if e, ok := s.entries[name]; !ok || !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	children := append([]string(nil), s.children[name]...)
+	sort.Strings(children)
+	out := make([]fs.DirEntry, len(children))
+	for i, c := range children {
+		out[i] = fs.FileInfoToDirEntry(s.entries[path.Join(name, c)].info)
+	}
+	return out, nil
+}
+
+func (s *tarGZStore) Open(name string) (fs.File, error) {
+	name = cleanFSPath(name)
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.info.IsDir() {
+		entries, err := s.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &tarDirHandle{info: e.info, entries: entries}, nil
+	}
+	return &tarFileHandle{info: e.info, Reader: bytes.NewReader(e.data)}, nil
+}
+
+func (s *tarGZStore) Readlink(name string) (string, error) {
+	e, ok := s.entries[cleanFSPath(name)]
+	if !ok || e.info.Mode().Type() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.link, nil
+}
+
+func cleanFSPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// tarDirInfo synthesizes a directory fs.FileInfo for an ancestor
+// directory that had no explicit entry in the tar stream.
+func tarDirInfo(name string) fs.FileInfo {
+	return tarSyntheticDir(name)
+}
+
+type tarSyntheticDir string
+
+func (d tarSyntheticDir) Name() string       { return string(d) }
+func (d tarSyntheticDir) Size() int64        { return 0 }
+func (d tarSyntheticDir) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (d tarSyntheticDir) ModTime() time.Time { return time.Time{} }
+func (d tarSyntheticDir) IsDir() bool        { return true }
+func (d tarSyntheticDir) Sys() interface{}   { return nil }
+
+type tarFileHandle struct {
+	info fs.FileInfo
+	*bytes.Reader
+}
+
+func (f *tarFileHandle) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *tarFileHandle) Close() error               { return nil }
+
+type tarDirHandle struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (d *tarDirHandle) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *tarDirHandle) Close() error               { return nil }
+func (d *tarDirHandle) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+func (d *tarDirHandle) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		out := d.entries[d.pos:]
+		d.pos = len(d.entries)
+		return out, nil
+	}
+	if d.pos >= len(d.entries) {
+		return nil, io.EOF
+	}
+	end := d.pos + n
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.pos:end]
+	d.pos = end
+	return out, nil
+}
+
+// fsOpenRaw opens p directly on the local filesystem, for streaming
+// an archive store's own backing file through unmodified.
+func fsOpenRaw(p string) (*os.File, error) {
+	return os.Open(p)
+}
+
+// asReadSeeker adapts fs.File to io.ReadSeeker, which http.ServeContent
+// requires for range support. Local files already implement it; for
+// archive entries (not natively seekable once decompressed) the
+// contents are buffered in memory.
+func asReadSeeker(f fs.File) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
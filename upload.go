@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// handleWrite dispatches POST, PUT, PATCH, and DELETE requests to
+// create, overwrite, rename, and remove files and directories under
+// the server's store, subject to the permissions granted by s.acl.
+// Only a local filesystem store supports writes.
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request, relpath string) {
+	if _, ok := localDir(s.store); !ok {
+		http.Error(w, "this store is read-only", http.StatusNotImplemented)
+		return
+	}
+	perms := s.acl.Perms(relpath)
+	if !authorize(w, r, perms.Auth) {
+		return
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		if !perms.Upload {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPut && r.URL.Query().Get("edit") == "1" {
+			s.handleEditSave(w, r, relpath)
+			return
+		}
+		s.handleUpload(w, r, relpath)
+	case http.MethodPatch:
+		if !perms.Delete {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		s.handleRename(w, r, relpath)
+	case http.MethodDelete:
+		if !perms.Delete {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		s.handleDelete(w, r, relpath)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUpload creates or overwrites files under relpath. Browsers
+// send a multipart form; curl and other simple clients can PUT/POST
+// the raw file body directly.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, relpath string) {
+	dir, _ := localDir(s.store)
+	if r.URL.Query().Has("mkdir") {
+		if err := os.MkdirAll(path.Join(dir, relpath), 0o755); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "multipart/form-data" {
+		s.handleMultipartUpload(w, r, relpath)
+		return
+	}
+	target := path.Join(dir, relpath)
+	if err := os.MkdirAll(path.Dir(target), 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeFileAtomic(target, r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleMultipartUpload(w http.ResponseWriter, r *http.Request, relpath string) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root, _ := localDir(s.store)
+	dir := path.Join(root, relpath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, headers := range r.MultipartForm.File {
+		for _, fh := range headers {
+			f, err := fh.Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = writeFileAtomic(path.Join(dir, filepath.Base(fh.Filename)), f)
+			f.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// writeFileAtomic writes r to name by writing to a temporary file in
+// the same directory, fsyncing it, and renaming it into place.
+func writeFileAtomic(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp(path.Dir(name), ".cheesedex-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// handleRename moves relpath to the path given by the "to" query
+// parameter, both resolved relative to the store's local directory.
+// handleWrite has already required Delete on relpath, since a rename
+// removes the file from its source; the destination must separately
+// be covered by its own Upload grant (and satisfy its own Auth), the
+// same as a fresh upload there would need.
+func (s *Server) handleRename(w http.ResponseWriter, r *http.Request, relpath string) {
+	dest := r.URL.Query().Get("to")
+	if dest == "" {
+		http.Error(w, "missing 'to' query parameter", http.StatusBadRequest)
+		return
+	}
+	destpath := path.Clean("/" + dest)
+	destperms := s.acl.Perms(destpath)
+	if !destperms.Upload {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if !authorize(w, r, destperms.Auth) {
+		return
+	}
+	dir, _ := localDir(s.store)
+	src := path.Join(dir, relpath)
+	dst := path.Join(dir, destpath)
+	if err := os.Rename(src, dst); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDelete removes relpath, which may be a file or a directory.
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, relpath string) {
+	dir, _ := localDir(s.store)
+	if err := os.RemoveAll(path.Join(dir, relpath)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}